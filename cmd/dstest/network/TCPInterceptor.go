@@ -1,16 +1,111 @@
 package network
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// defaultTerminationDelay is how long the still-open side of a connection
+// is allowed to sit idle after the other side half-closes before both
+// sides are forcibly closed. It's measured from the last byte forwarded
+// on either direction, not from the moment of the first half-close, so a
+// slow-but-alive peer (e.g. a request/response RPC that half-closes after
+// writing its request and takes a while to answer) isn't killed early. It
+// defaults to several seconds, comfortably above any link Latency/Jitter
+// a test is likely to configure via LinkFaults.
+const defaultTerminationDelay = 5 * time.Second
+
+// defaultRouteMatchTimeout and defaultRouteMatchMaxBytes bound how long
+// and how much of a connection's opening bytes RouteMatchers get to peek
+// at before handleConnection gives up and falls back to the static
+// PortMap entry.
+const (
+	defaultRouteMatchTimeout  = 200 * time.Millisecond
+	defaultRouteMatchMaxBytes = 4096
+)
+
+// defaultDialTimeout bounds how long handleConnection will wait on
+// net.Dial to the target node. Without it, a hung/unreachable target
+// leaves the dial goroutine (and the clientConn it's holding open)
+// running past Shutdown, since there's nothing to cancel an unbounded
+// dial.
+const defaultDialTimeout = 10 * time.Second
+
 type TCPInterceptor struct {
 	BaseInterceptor
 	Listener net.Listener
+
+	// ProxyProtocol, when non-empty, overrides the cluster-wide default
+	// from NetworkManager.Config.NetworkConfig.ProxyProtocol for this
+	// interceptor only.
+	ProxyProtocol ProxyProtocolMode
+
+	// TerminationDelay is how long the still-open side of a connection
+	// may stay idle after the other side half-closes before both sides
+	// are forcibly closed. Defaults to defaultTerminationDelay (5s).
+	//
+	// This is an idle timeout measured from the last byte forwarded on
+	// either direction, not a fixed countdown started at the moment of
+	// the first half-close: the still-open side resets it every time it
+	// forwards a message, so a slow-but-alive response isn't killed
+	// early. Test authors who want teardown to happen quickly after a
+	// half-close should set TerminationDelay explicitly rather than
+	// relying on the default, which is sized to comfortably exceed any
+	// LinkFaults.Latency/Jitter a test is likely to configure.
+	TerminationDelay time.Duration
+
+	// RouteMatchers, when non-empty, are tried in order against the
+	// opening bytes of each new connection; the first one to match
+	// replaces the static PortMap receiver for that connection only.
+	RouteMatchers []RouteMatcher
+	// RouteMatchTimeout bounds how long matchRoute waits for enough
+	// bytes to decide. Defaults to defaultRouteMatchTimeout.
+	RouteMatchTimeout time.Duration
+	// RouteMatchMaxBytes bounds how many bytes matchRoute will peek at
+	// before giving up. Defaults to defaultRouteMatchMaxBytes.
+	RouteMatchMaxBytes int
+
+	// DialTimeout bounds how long handleConnection waits for net.Dial to
+	// the target node before giving up. Defaults to defaultDialTimeout.
+	DialTimeout time.Duration
+
+	// activeConns tracks every connection currently being proxied, keyed
+	// by the accepted clientConn, so Shutdown can close them instead of
+	// leaving their goroutines running. Connections are registered the
+	// moment they're accepted - before route matching or dialing the
+	// target, both of which can block for a while - so a connection
+	// stuck in either doesn't survive Shutdown.
+	activeConns sync.Map
+}
+
+// activeConn is the value type stored in TCPInterceptor.activeConns. target
+// starts nil (the dial hasn't completed yet) and is filled in once it has;
+// closeAll closes whichever of the two are non-nil at the time it runs.
+type activeConn struct {
+	mu     sync.Mutex
+	client net.Conn
+	target net.Conn
+}
+
+func (c *activeConn) setTarget(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.target = conn
+}
+
+func (c *activeConn) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client.Close()
+	if c.target != nil {
+		c.target.Close()
+	}
 }
 
 // Check if BaseInterceptor implements Interceptor interface
@@ -20,6 +115,50 @@ func (ni *TCPInterceptor) Init(id int, port int, nm *Manager) {
 	logPrefix := fmt.Sprintf("[TCP Interceptor %d] ", id)
 	logger := log.New(log.Writer(), logPrefix, log.LstdFlags)
 	ni.BaseInterceptor.Init(id, port, nm, logger)
+
+	if ni.TerminationDelay == 0 {
+		ni.TerminationDelay = defaultTerminationDelay
+	}
+	if ni.RouteMatchTimeout == 0 {
+		ni.RouteMatchTimeout = defaultRouteMatchTimeout
+	}
+	if ni.RouteMatchMaxBytes == 0 {
+		ni.RouteMatchMaxBytes = defaultRouteMatchMaxBytes
+	}
+	if ni.DialTimeout == 0 {
+		ni.DialTimeout = defaultDialTimeout
+	}
+}
+
+// matchRoute wraps clientConn in a bufio.Reader and peeks at its opening
+// bytes, growing the peeked window until a RouteMatcher fires, the
+// RouteMatchTimeout elapses, or RouteMatchMaxBytes is reached. The peeked
+// bytes are never consumed, so clientReader (not clientConn) must be used
+// to read the connection afterwards.
+func (ni *TCPInterceptor) matchRoute(clientConn net.Conn) (clientReader *bufio.Reader, receiver int, matcherName string, matched bool) {
+	clientReader = bufio.NewReaderSize(clientConn, ni.RouteMatchMaxBytes)
+	if len(ni.RouteMatchers) == 0 {
+		return clientReader, 0, "", false
+	}
+
+	clientConn.SetReadDeadline(time.Now().Add(ni.RouteMatchTimeout))
+	defer clientConn.SetReadDeadline(time.Time{})
+
+	for n := 1; ; n *= 2 {
+		if n > ni.RouteMatchMaxBytes {
+			n = ni.RouteMatchMaxBytes
+		}
+		peeked, peekErr := clientReader.Peek(n)
+		for _, m := range ni.RouteMatchers {
+			if r, ok := m.Match(peeked); ok {
+				return clientReader, r, m.Name(), true
+			}
+		}
+		if peekErr != nil || n == ni.RouteMatchMaxBytes {
+			break
+		}
+	}
+	return clientReader, 0, "", false
 }
 
 func (ni *TCPInterceptor) Run() (err error) {
@@ -47,7 +186,12 @@ func (ni *TCPInterceptor) Run() (err error) {
 				ni.Log.Printf("Error accepting connection: %s\n", err.Error())
 				return
 			}
-			go ni.handleConnection(conn)
+			// Registered before matchRoute/dialing (both of which can
+			// block for a while) so a connection parked in either
+			// still gets closed by Shutdown instead of outliving it.
+			ac := &activeConn{client: conn}
+			ni.activeConns.Store(conn, ac)
+			go ni.handleConnection(conn, ac)
 		}
 	}()
 
@@ -58,9 +202,15 @@ func (ni *TCPInterceptor) Shutdown() {
 	if ni.Listener != nil {
 		ni.Listener.Close()
 	}
+
+	ni.activeConns.Range(func(key, value interface{}) bool {
+		value.(*activeConn).closeAll()
+		return true
+	})
 }
 
-func (ni *TCPInterceptor) handleConnection(clientConn net.Conn) {
+func (ni *TCPInterceptor) handleConnection(clientConn net.Conn, ac *activeConn) {
+	defer ni.activeConns.Delete(clientConn)
 	defer clientConn.Close()
 
 	// Get sender/receiver mapping based on interceptor port
@@ -73,39 +223,148 @@ func (ni *TCPInterceptor) handleConnection(clientConn net.Conn) {
 	sender := pair.Sender
 	receiver := pair.Receiver
 
+	clientReader, matchedReceiver, matcherName, matched := ni.matchRoute(clientConn)
+	if matched {
+		ni.Log.Printf("Route matcher %q selected node%d for connection on port %d\n", matcherName, matchedReceiver, ni.Port)
+		receiver = matchedReceiver
+	}
+
 	// Calculate the actual listening port of the target node
 	// The receiver node listens on BaseReplicaPort + receiver + 1
 	targetPort := ni.NetworkManager.Config.NetworkConfig.BaseReplicaPort + receiver + 1
 	targetAddr := fmt.Sprintf("127.0.0.1:%d", targetPort)
 
+	if ni.NetworkManager.isPartitioned(sender, receiver) {
+		ni.Log.Printf("Refusing connection node%d -> node%d: link is partitioned\n", sender, receiver)
+		return
+	}
+
 	ni.Log.Printf("Proxying connection: node%d -> node%d (target %s)\n", sender, receiver, targetAddr)
 
-	// Connect to the target node (forward immediately; the TCP proxy bypasses the scheduler)
-	targetConn, err := net.Dial("tcp", targetAddr)
+	// Connect to the target node. Bounded by DialTimeout so a hung or
+	// unreachable target can't block this goroutine (and keep clientConn
+	// open) indefinitely past Shutdown.
+	targetConn, err := net.DialTimeout("tcp", targetAddr, ni.DialTimeout)
 	if err != nil {
 		ni.Log.Printf("Error connecting to target %s: %s\n", targetAddr, err.Error())
 		return
 	}
 	defer targetConn.Close()
+	ac.setTarget(targetConn)
+
+	proxyProtocol := ni.ProxyProtocol
+	if proxyProtocol == "" {
+		proxyProtocol = ni.NetworkManager.Config.NetworkConfig.ProxyProtocol
+	}
+	if err := writeProxyProtocolHeader(targetConn, proxyProtocol, ni.NetworkManager.Config.ClusterID, sender, targetAddr); err != nil {
+		ni.Log.Printf("Error writing PROXY protocol header node%d -> node%d: %s\n", sender, receiver, err.Error())
+		return
+	}
 
-	// Two-way proxy
+	framer := ni.NetworkManager.framerFor(sender, receiver)
+
+	// Two-way proxy, one framed message at a time, each routed through the
+	// scheduler so fault injection and ordering control apply to TCP the
+	// same way they already do to UDP.
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	// client -> target
+	var clientToTargetSeq, targetToClientSeq uint64
+
+	var closeOnce sync.Once
+	forceClose := func() {
+		closeOnce.Do(func() {
+			clientConn.Close()
+			targetConn.Close()
+		})
+	}
+	// terminator is touched by both directions on every message they
+	// forward, so once one side half-closes, the countdown it starts
+	// only fires once the *other* (still open) side has genuinely gone
+	// idle for TerminationDelay - not just because it happened to be
+	// slow writing one response.
+	terminator := newConnTerminator(ni.TerminationDelay, forceClose)
+
 	go func() {
 		defer wg.Done()
-		io.Copy(targetConn, clientConn)
-		targetConn.(*net.TCPConn).CloseWrite()
+		// client -> target: once the client sends EOF, tell the target
+		// there's nothing more coming from this sender. clientReader
+		// replays whatever matchRoute peeked before clientConn itself.
+		ni.pumpFramed(clientReader, targetConn, framer, sender, receiver, ClientToTarget, matcherName, &clientToTargetSeq, terminator.touch)
+		if tc, ok := targetConn.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+		terminator.start()
 	}()
 
-	// target -> client
 	go func() {
 		defer wg.Done()
-		io.Copy(clientConn, targetConn)
-		clientConn.(*net.TCPConn).CloseWrite()
+		// target -> client: once the target sends EOF, tell the client
+		// there's nothing more coming from the target.
+		ni.pumpFramed(targetConn, clientConn, framer, sender, receiver, TargetToClient, matcherName, &targetToClientSeq, terminator.touch)
+		if cc, ok := clientConn.(*net.TCPConn); ok {
+			cc.CloseWrite()
+		}
+		terminator.start()
 	}()
 
 	wg.Wait()
+	terminator.stop()
+	forceClose()
 	ni.Log.Printf("Connection closed: node%d -> node%d\n", sender, receiver)
 }
+
+// pumpFramed reads one message at a time from src using framer, submits it
+// to the scheduler tagged with (sender, receiver, direction, seq), and
+// forwards it to dst once the scheduler releases it. With the default
+// RawStreamFramer this degenerates to the previous raw io.Copy behavior,
+// just passed through the scheduler one chunk at a time instead of
+// bypassing it entirely. touch is called on every message read, so the
+// caller's connTerminator knows this direction is still making progress.
+func (ni *TCPInterceptor) pumpFramed(src io.Reader, dst io.Writer, framer MessageFramer, sender, receiver int, dir Direction, matcherName string, seq *uint64, touch func()) {
+	for {
+		msg, err := framer.ReadMessage(src)
+		if len(msg) > 0 {
+			touch()
+			drop, duplicate := ni.NetworkManager.applyLinkFaults(sender, receiver, dir, len(msg))
+			if drop {
+				ni.Log.Printf("Dropped message node%d -> node%d (%s)\n", sender, receiver, dir)
+			} else {
+				event := SchedulerEvent{
+					Sender:      sender,
+					Receiver:    receiver,
+					Direction:   dir,
+					Seq:         atomic.AddUint64(seq, 1) - 1,
+					Payload:     msg,
+					MatcherName: matcherName,
+				}
+				// A Manager with no Scheduler configured forwards
+				// directly, so RawStreamFramer traffic on a Manager built
+				// the way pre-existing callers already build one stays
+				// backward compatible instead of panicking on nil.
+				if ni.NetworkManager.Scheduler != nil {
+					if schedErr := ni.NetworkManager.Scheduler.Schedule(event); schedErr != nil {
+						ni.Log.Printf("Scheduler rejected message node%d -> node%d (%s): %s\n", sender, receiver, dir, schedErr.Error())
+						return
+					}
+				}
+				if werr := framer.WriteMessage(dst, event.Payload); werr != nil {
+					ni.Log.Printf("Error forwarding message node%d -> node%d (%s): %s\n", sender, receiver, dir, werr.Error())
+					return
+				}
+				if duplicate {
+					if werr := framer.WriteMessage(dst, event.Payload); werr != nil {
+						ni.Log.Printf("Error duplicating message node%d -> node%d (%s): %s\n", sender, receiver, dir, werr.Error())
+						return
+					}
+				}
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				ni.Log.Printf("Error reading message node%d -> node%d (%s): %s\n", sender, receiver, dir, err.Error())
+			}
+			return
+		}
+	}
+}
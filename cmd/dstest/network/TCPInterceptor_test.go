@@ -0,0 +1,159 @@
+package network
+
+import (
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestInterceptor builds a TCPInterceptor ready for handleConnection,
+// bypassing Init (which delegates to the embedded BaseInterceptor) so these
+// tests only exercise TCPInterceptor's own logic.
+func newTestInterceptor(ln net.Listener, nm *Manager) *TCPInterceptor {
+	ni := &TCPInterceptor{
+		Listener:           ln,
+		RouteMatchTimeout:  defaultRouteMatchTimeout,
+		RouteMatchMaxBytes: defaultRouteMatchMaxBytes,
+		DialTimeout:        defaultDialTimeout,
+		TerminationDelay:   defaultTerminationDelay,
+	}
+	ni.Log = log.New(io.Discard, "", 0)
+	ni.NetworkManager = nm
+	return ni
+}
+
+// acceptLoop mirrors the registration/dispatch Run() does, without the
+// BaseInterceptor.Run() call this package fragment can't provide.
+func acceptLoop(ni *TCPInterceptor) {
+	go func() {
+		for {
+			conn, err := ni.Listener.Accept()
+			if err != nil {
+				return
+			}
+			ac := &activeConn{client: conn}
+			ni.activeConns.Store(conn, ac)
+			go ni.handleConnection(conn, ac)
+		}
+	}()
+}
+
+// TestHandleConnectionProxiesDataEndToEnd drives a real client -> target
+// round trip through handleConnection, confirming the happy path still
+// works with activeConns now registered at accept time.
+func TestHandleConnectionProxiesDataEndToEnd(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen target: %v", err)
+	}
+	defer target.Close()
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn) // echo
+	}()
+
+	_, targetPortStr, _ := net.SplitHostPort(target.Addr().String())
+	targetPort, err := strconv.Atoi(targetPortStr)
+	if err != nil {
+		t.Fatalf("parse target port: %v", err)
+	}
+
+	front, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen front: %v", err)
+	}
+	defer front.Close()
+
+	nm := &Manager{
+		PortMap: map[int]PortPair{0: {Sender: 1, Receiver: 2}},
+		Config:  Config{NetworkConfig: NetworkConfig{BaseReplicaPort: targetPort - 2 - 1}},
+	}
+	ni := newTestInterceptor(front, nm)
+	acceptLoop(ni)
+
+	clientConn, err := net.Dial("tcp", front.Addr().String())
+	if err != nil {
+		t.Fatalf("dial front: %v", err)
+	}
+	defer clientConn.Close()
+
+	want := []byte("hello through the proxy")
+	if _, err := clientConn.Write(want); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	clientConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(clientConn, got); err != nil {
+		t.Fatalf("read echo: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("echoed %q, want %q", got, want)
+	}
+}
+
+// TestShutdownClosesConnectionStuckInRouteMatching reproduces the bug the
+// maintainer reported: a connection parked in matchRoute's Peek (which can
+// legitimately block for up to RouteMatchTimeout) used to be invisible to
+// activeConns, and survived Shutdown until its own timeout fired
+// independently. It's registered at accept time now, so Shutdown must
+// close it immediately instead.
+func TestShutdownClosesConnectionStuckInRouteMatching(t *testing.T) {
+	front, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen front: %v", err)
+	}
+
+	nm := &Manager{
+		PortMap: map[int]PortPair{0: {Sender: 1, Receiver: 2}},
+	}
+	ni := newTestInterceptor(front, nm)
+	ni.RouteMatchTimeout = 10 * time.Second
+	ni.RouteMatchers = []RouteMatcher{PrefixMatcher{Prefix: []byte("RAFTv1"), Receiver: 2}}
+	acceptLoop(ni)
+
+	clientConn, err := net.Dial("tcp", front.Addr().String())
+	if err != nil {
+		t.Fatalf("dial front: %v", err)
+	}
+	defer clientConn.Close()
+	// Deliberately send nothing: matchRoute blocks in Peek until either a
+	// RouteMatcher fires, RouteMatchTimeout elapses, or the conn closes.
+
+	waitUntil := time.Now().Add(time.Second)
+	for {
+		if activeConnCount(ni) > 0 {
+			break
+		}
+		if time.Now().After(waitUntil) {
+			t.Fatal("connection was never registered in activeConns")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ni.Shutdown()
+
+	clientConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1)
+	// A read timeout means the connection was still open when the 2s
+	// deadline passed, i.e. Shutdown did not close it.
+	_, err = clientConn.Read(buf)
+	if ne, ok := err.(net.Error); err == nil || (ok && ne.Timeout()) {
+		t.Fatal("expected Shutdown to close a connection stuck in route matching well before RouteMatchTimeout")
+	}
+}
+
+func activeConnCount(ni *TCPInterceptor) int {
+	n := 0
+	ni.activeConns.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
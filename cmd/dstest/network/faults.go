@@ -0,0 +1,214 @@
+package network
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LinkFaults describes the fault profile applied to traffic flowing
+// between a sender and a receiver, letting a test script a partition or
+// degraded link the same way Jepsen-style tests do.
+type LinkFaults struct {
+	// Latency and Jitter delay every message by Latency +/- a random
+	// amount up to Jitter before it's forwarded.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// DropProb is the probability, in [0, 1], that a given message is
+	// silently dropped instead of forwarded.
+	DropProb float64
+	// DuplicateProb is the probability, in [0, 1], that a forwarded
+	// message is resent once more immediately after.
+	DuplicateProb float64
+
+	// Partitioned, when true, refuses new connections between sender and
+	// receiver outright, simulating a hard network partition.
+	Partitioned bool
+
+	// BandwidthBytesPerSec caps the link's throughput via a token
+	// bucket. Zero or negative means unlimited.
+	BandwidthBytesPerSec int64
+	// ShareBandwidth makes both directions draw from a single token
+	// bucket instead of one per direction.
+	ShareBandwidth bool
+
+	// ClientToTargetOverride and TargetToClientOverride, when set,
+	// replace Latency/Jitter/DropProb/DuplicateProb for that direction
+	// only. BandwidthBytesPerSec and ShareBandwidth always come from the
+	// top-level LinkFaults.
+	ClientToTargetOverride *LinkFaults
+	TargetToClientOverride *LinkFaults
+}
+
+func (f LinkFaults) forDirection(dir Direction) LinkFaults {
+	var override *LinkFaults
+	if dir == ClientToTarget {
+		override = f.ClientToTargetOverride
+	} else {
+		override = f.TargetToClientOverride
+	}
+	if override == nil {
+		return f
+	}
+	resolved := f
+	resolved.Latency = override.Latency
+	resolved.Jitter = override.Jitter
+	resolved.DropProb = override.DropProb
+	resolved.DuplicateProb = override.DuplicateProb
+	return resolved
+}
+
+// linkFaultState is the live state backing a registered LinkFaults: the
+// profile itself plus whatever token buckets it implies.
+type linkFaultState struct {
+	faults LinkFaults
+
+	shared *tokenBucket
+	c2t    *tokenBucket
+	t2c    *tokenBucket
+}
+
+func newLinkFaultState(f LinkFaults) *linkFaultState {
+	s := &linkFaultState{faults: f}
+	if f.BandwidthBytesPerSec > 0 {
+		if f.ShareBandwidth {
+			s.shared = newTokenBucket(f.BandwidthBytesPerSec)
+		} else {
+			s.c2t = newTokenBucket(f.BandwidthBytesPerSec)
+			s.t2c = newTokenBucket(f.BandwidthBytesPerSec)
+		}
+	}
+	return s
+}
+
+func (s *linkFaultState) bucketFor(dir Direction) *tokenBucket {
+	if s.shared != nil {
+		return s.shared
+	}
+	if dir == ClientToTarget {
+		return s.c2t
+	}
+	return s.t2c
+}
+
+// SetLinkFaults installs f as the fault profile for traffic between
+// sender and receiver, replacing anything previously registered for that
+// link.
+func (m *Manager) SetLinkFaults(sender, receiver int, f LinkFaults) {
+	m.faultsMu.Lock()
+	defer m.faultsMu.Unlock()
+	if m.faultState == nil {
+		m.faultState = make(map[PortPairKey]*linkFaultState)
+	}
+	m.faultState[PortPairKey{Sender: sender, Receiver: receiver}] = newLinkFaultState(f)
+}
+
+// Heal removes any fault profile registered for traffic between sender
+// and receiver, restoring the link to its default healthy behavior.
+func (m *Manager) Heal(sender, receiver int) {
+	m.faultsMu.Lock()
+	defer m.faultsMu.Unlock()
+	delete(m.faultState, PortPairKey{Sender: sender, Receiver: receiver})
+}
+
+func (m *Manager) faultStateFor(sender, receiver int) *linkFaultState {
+	m.faultsMu.RLock()
+	defer m.faultsMu.RUnlock()
+	return m.faultState[PortPairKey{Sender: sender, Receiver: receiver}]
+}
+
+// isPartitioned reports whether sender and receiver currently have a hard
+// partition configured between them.
+func (m *Manager) isPartitioned(sender, receiver int) bool {
+	s := m.faultStateFor(sender, receiver)
+	return s != nil && s.faults.Partitioned
+}
+
+// applyLinkFaults delays, throttles, and probabilistically drops a message
+// of n bytes travelling in direction dir between sender and receiver. It
+// reports whether the message should be dropped and whether it should
+// additionally be duplicated once it's forwarded.
+func (m *Manager) applyLinkFaults(sender, receiver int, dir Direction, n int) (drop, duplicate bool) {
+	s := m.faultStateFor(sender, receiver)
+	if s == nil {
+		return false, false
+	}
+
+	// Checked per message, not just when the connection was first
+	// accepted, so a partition declared mid-test (the Jepsen-style use
+	// case this exists for) also stops traffic already flowing on
+	// connections that were established before the partition started.
+	if s.faults.Partitioned {
+		return true, false
+	}
+
+	f := s.faults.forDirection(dir)
+
+	if bucket := s.bucketFor(dir); bucket != nil {
+		bucket.take(n)
+	}
+
+	if f.Latency > 0 || f.Jitter > 0 {
+		delay := f.Latency
+		if f.Jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(2*f.Jitter))) - f.Jitter
+			if delay < 0 {
+				delay = 0
+			}
+		}
+		time.Sleep(delay)
+	}
+
+	if f.DropProb > 0 && rand.Float64() < f.DropProb {
+		return true, false
+	}
+
+	return false, f.DuplicateProb > 0 && rand.Float64() < f.DuplicateProb
+}
+
+// tokenBucket rate-limits throughput to rate bytes/sec, blocking callers
+// that exceed it until enough tokens have refilled.
+type tokenBucket struct {
+	mu         sync.Mutex
+	rate       int64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(rateBytesPerSec int64) *tokenBucket {
+	return &tokenBucket{
+		rate:       rateBytesPerSec,
+		tokens:     float64(rateBytesPerSec),
+		lastRefill: time.Now(),
+	}
+}
+
+// take blocks until n bytes' worth of tokens are available, refilling the
+// bucket based on elapsed time since the last call. A request larger than
+// the bucket's capacity (rate) is granted once the bucket is full, leaving
+// it in debt so later callers wait for the excess to be paid back.
+func (tb *tokenBucket) take(n int) {
+	if tb == nil || tb.rate <= 0 {
+		return
+	}
+	for {
+		tb.mu.Lock()
+		now := time.Now()
+		tb.tokens += now.Sub(tb.lastRefill).Seconds() * float64(tb.rate)
+		if cap := float64(tb.rate); tb.tokens > cap {
+			tb.tokens = cap
+		}
+		tb.lastRefill = now
+
+		if tb.tokens >= float64(n) || tb.tokens >= float64(tb.rate) {
+			tb.tokens -= float64(n)
+			tb.mu.Unlock()
+			return
+		}
+
+		wait := time.Duration((float64(n) - tb.tokens) / float64(tb.rate) * float64(time.Second))
+		tb.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
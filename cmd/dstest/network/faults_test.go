@@ -0,0 +1,108 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyLinkFaultsPartitionDropsEveryMessageUntilHealed(t *testing.T) {
+	m := &Manager{}
+	m.SetLinkFaults(1, 2, LinkFaults{Partitioned: true})
+
+	for i := 0; i < 5; i++ {
+		if drop, _ := m.applyLinkFaults(1, 2, ClientToTarget, 10); !drop {
+			t.Fatalf("message %d: expected drop while partitioned", i)
+		}
+	}
+
+	m.Heal(1, 2)
+	if drop, _ := m.applyLinkFaults(1, 2, ClientToTarget, 10); drop {
+		t.Fatal("expected no drop after Heal")
+	}
+}
+
+func TestApplyLinkFaultsDropProbBounds(t *testing.T) {
+	m := &Manager{}
+
+	m.SetLinkFaults(1, 2, LinkFaults{DropProb: 1})
+	if drop, _ := m.applyLinkFaults(1, 2, ClientToTarget, 1); !drop {
+		t.Fatal("DropProb=1 should always drop")
+	}
+
+	m.SetLinkFaults(1, 2, LinkFaults{DropProb: 0})
+	if drop, _ := m.applyLinkFaults(1, 2, ClientToTarget, 1); drop {
+		t.Fatal("DropProb=0 should never drop")
+	}
+}
+
+func TestApplyLinkFaultsDuplicateProbBounds(t *testing.T) {
+	m := &Manager{}
+
+	m.SetLinkFaults(1, 2, LinkFaults{DuplicateProb: 1})
+	if _, dup := m.applyLinkFaults(1, 2, ClientToTarget, 1); !dup {
+		t.Fatal("DuplicateProb=1 should always duplicate")
+	}
+
+	m.SetLinkFaults(1, 2, LinkFaults{DuplicateProb: 0})
+	if _, dup := m.applyLinkFaults(1, 2, ClientToTarget, 1); dup {
+		t.Fatal("DuplicateProb=0 should never duplicate")
+	}
+}
+
+func TestApplyLinkFaultsDropProbIsRoughlyRespected(t *testing.T) {
+	m := &Manager{}
+	m.SetLinkFaults(1, 2, LinkFaults{DropProb: 0.5})
+
+	const trials = 2000
+	drops := 0
+	for i := 0; i < trials; i++ {
+		if drop, _ := m.applyLinkFaults(1, 2, ClientToTarget, 1); drop {
+			drops++
+		}
+	}
+
+	if got := float64(drops) / trials; got < 0.4 || got > 0.6 {
+		t.Errorf("observed drop rate %.2f, want close to 0.5", got)
+	}
+}
+
+func TestApplyLinkFaultsDirectionalOverride(t *testing.T) {
+	m := &Manager{}
+	m.SetLinkFaults(1, 2, LinkFaults{
+		DropProb:               0,
+		ClientToTargetOverride: &LinkFaults{DropProb: 1},
+	})
+
+	if drop, _ := m.applyLinkFaults(1, 2, ClientToTarget, 1); !drop {
+		t.Fatal("client->target override should force a drop")
+	}
+	if drop, _ := m.applyLinkFaults(1, 2, TargetToClient, 1); drop {
+		t.Fatal("target->client should use the base (non-dropping) profile")
+	}
+}
+
+func TestTokenBucketThrottlesThroughput(t *testing.T) {
+	bucket := newTokenBucket(100) // 100 bytes/sec, capacity starts full
+
+	start := time.Now()
+	bucket.take(100) // within initial capacity, should not block meaningfully
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("first take blocked for %s, want ~instant", elapsed)
+	}
+
+	start = time.Now()
+	bucket.take(50) // bucket is now empty, must wait ~500ms for refill
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("second take returned after %s, want >= ~400ms", elapsed)
+	}
+}
+
+func TestTokenBucketUnlimitedWhenRateIsZero(t *testing.T) {
+	var bucket *tokenBucket // nil, as used when BandwidthBytesPerSec <= 0
+
+	start := time.Now()
+	bucket.take(1 << 20)
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Fatalf("nil bucket blocked for %s, want instant", elapsed)
+	}
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestFramedFramersPreserveMessageBoundaries checks that framers which add
+// their own framing (everything but RawStreamFramer, which has none) can
+// write several messages into one stream and read each one back intact.
+func TestFramedFramersPreserveMessageBoundaries(t *testing.T) {
+	messages := [][]byte{
+		[]byte("hello"),
+		[]byte(""),
+		bytes.Repeat([]byte("x"), 1024),
+	}
+
+	framers := map[string]MessageFramer{
+		"length-prefixed": LengthPrefixedFramer{},
+		"newline":         NewlineDelimitedFramer{},
+		"varint":          VarintFramer{},
+	}
+
+	for name, framer := range framers {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			for _, msg := range messages {
+				if err := framer.WriteMessage(&buf, msg); err != nil {
+					t.Fatalf("WriteMessage(%q): %v", msg, err)
+				}
+			}
+
+			for _, want := range messages {
+				got, err := framer.ReadMessage(&buf)
+				if err != nil && err != io.EOF {
+					t.Fatalf("ReadMessage: %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("ReadMessage = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestRawStreamFramerRoundTrip checks that a single RawStreamFramer write
+// comes back unmodified; it has no framing of its own, so it can't
+// preserve boundaries across multiple writes sharing one stream.
+func TestRawStreamFramerRoundTrip(t *testing.T) {
+	for _, payload := range [][]byte{[]byte("hello"), bytes.Repeat([]byte("x"), 1024)} {
+		var buf bytes.Buffer
+		framer := RawStreamFramer{}
+
+		if err := framer.WriteMessage(&buf, payload); err != nil {
+			t.Fatalf("WriteMessage(%q): %v", payload, err)
+		}
+		got, err := framer.ReadMessage(&buf)
+		if err != nil && err != io.EOF {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("ReadMessage = %q, want %q", got, payload)
+		}
+	}
+}
+
+func TestLengthPrefixedFramerWidths(t *testing.T) {
+	for _, width := range []int{1, 2, 4, 8} {
+		framer := LengthPrefixedFramer{PrefixBytes: width}
+		var buf bytes.Buffer
+		payload := []byte("payload")
+
+		if err := framer.WriteMessage(&buf, payload); err != nil {
+			t.Fatalf("width %d: WriteMessage: %v", width, err)
+		}
+		got, err := framer.ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("width %d: ReadMessage: %v", width, err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("width %d: ReadMessage = %q, want %q", width, got, payload)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package network
+
+import "sync"
+
+// PortPair describes the two nodes an interceptor's listening port sits
+// between: traffic arriving on that port is understood to be flowing from
+// Sender to Receiver.
+type PortPair struct {
+	Sender   int
+	Receiver int
+}
+
+// NetworkConfig holds the static topology parameters interceptors use to
+// compute a replica's real listening address from its logical node ID.
+type NetworkConfig struct {
+	BaseReplicaPort int
+
+	// ProxyProtocol is the cluster-wide default PROXY protocol mode;
+	// individual TCPInterceptors can override it via their own
+	// ProxyProtocol field.
+	ProxyProtocol ProxyProtocolMode
+}
+
+// Config bundles the configuration a Manager is constructed with.
+type Config struct {
+	ClusterID     int
+	NetworkConfig NetworkConfig
+}
+
+// Manager holds the configuration for a cluster under test: the
+// sender/receiver mapping for each interceptor port, the scheduler, and
+// the per-link configuration (fault injection, framing) that governs how
+// traffic between nodes is intercepted.
+type Manager struct {
+	Config    Config
+	PortMap   map[int]PortPair
+	Scheduler Scheduler
+
+	framersMu sync.RWMutex
+	framers   map[PortPairKey]MessageFramer
+
+	faultsMu   sync.RWMutex
+	faultState map[PortPairKey]*linkFaultState
+}
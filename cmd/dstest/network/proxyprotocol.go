@@ -0,0 +1,82 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+)
+
+// ProxyProtocolMode selects whether, and in which version, an interceptor
+// writes a PROXY protocol header to the target connection immediately
+// after dialing it.
+type ProxyProtocolMode string
+
+const (
+	ProxyProtocolOff ProxyProtocolMode = "off"
+	ProxyProtocolV1  ProxyProtocolMode = "v1"
+	ProxyProtocolV2  ProxyProtocolMode = "v2"
+)
+
+// proxyProtocolV2Signature is the fixed 12-byte signature that opens every
+// PROXY protocol v2 header, per the spec.
+var proxyProtocolV2Signature = []byte{
+	0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A,
+}
+
+// writeProxyProtocolHeader writes a PROXY protocol header to w describing
+// a logical connection from node sender to targetAddr, so the receiving
+// replica can attribute the traffic to the right peer even though the
+// real TCP source is the interceptor itself (127.0.0.1). The synthesized
+// source address has the form 127.0.<clusterID>.<sender>, which is stable
+// across reconnects and unambiguous within a single test cluster.
+func writeProxyProtocolHeader(w io.Writer, mode ProxyProtocolMode, clusterID, sender int, targetAddr string) error {
+	if mode == ProxyProtocolOff || mode == "" {
+		return nil
+	}
+
+	dstHost, dstPortStr, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return fmt.Errorf("proxy protocol: invalid target address %q: %w", targetAddr, err)
+	}
+	dstPort, err := strconv.Atoi(dstPortStr)
+	if err != nil {
+		return fmt.Errorf("proxy protocol: invalid target port %q: %w", dstPortStr, err)
+	}
+
+	srcIP := fmt.Sprintf("127.0.%d.%d", clusterID&0xff, sender&0xff)
+	srcPort := 1024 + rand.Intn(64512)
+
+	switch mode {
+	case ProxyProtocolV1:
+		_, err := fmt.Fprintf(w, "PROXY TCP4 %s %s %d %d\r\n", srcIP, dstHost, srcPort, dstPort)
+		return err
+	case ProxyProtocolV2:
+		return writeProxyProtocolV2(w, srcIP, dstHost, srcPort, dstPort)
+	default:
+		return fmt.Errorf("proxy protocol: unknown mode %q", mode)
+	}
+}
+
+func writeProxyProtocolV2(w io.Writer, srcIP, dstIP string, srcPort, dstPort int) error {
+	addr := make([]byte, 12)
+	copy(addr[0:4], net.ParseIP(srcIP).To4())
+	copy(addr[4:8], net.ParseIP(dstIP).To4())
+	binary.BigEndian.PutUint16(addr[8:10], uint16(srcPort))
+	binary.BigEndian.PutUint16(addr[10:12], uint16(dstPort))
+
+	header := make([]byte, 0, len(proxyProtocolV2Signature)+4+len(addr))
+	header = append(header, proxyProtocolV2Signature...)
+	header = append(header, 0x21) // version 2, command PROXY
+	header = append(header, 0x11) // family AF_INET, protocol STREAM
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(addr)))
+	header = append(header, length...)
+	header = append(header, addr...)
+
+	_, err := w.Write(header)
+	return err
+}
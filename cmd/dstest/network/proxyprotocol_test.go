@@ -0,0 +1,58 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	proxyproto "github.com/pires/go-proxyproto"
+)
+
+func TestWriteProxyProtocolHeaderV1(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeProxyProtocolHeader(&buf, ProxyProtocolV1, 3, 7, "127.0.0.1:9001"); err != nil {
+		t.Fatalf("writeProxyProtocolHeader: %v", err)
+	}
+
+	header, err := proxyproto.Read(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("parsing emitted v1 header: %v", err)
+	}
+
+	if got, want := header.SourceAddr.String(), "127.0.3.7"; !strings.HasPrefix(got, want) {
+		t.Errorf("source address = %q, want prefix %q", got, want)
+	}
+	if got, want := header.DestinationAddr.String(), "127.0.0.1:9001"; got != want {
+		t.Errorf("destination address = %q, want %q", got, want)
+	}
+}
+
+func TestWriteProxyProtocolHeaderV2(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeProxyProtocolHeader(&buf, ProxyProtocolV2, 3, 7, "127.0.0.1:9001"); err != nil {
+		t.Fatalf("writeProxyProtocolHeader: %v", err)
+	}
+
+	header, err := proxyproto.Read(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("parsing emitted v2 header: %v", err)
+	}
+
+	if got, want := header.SourceAddr.String(), "127.0.3.7"; !strings.HasPrefix(got, want) {
+		t.Errorf("source address = %q, want prefix %q", got, want)
+	}
+	if got, want := header.DestinationAddr.String(), "127.0.0.1:9001"; got != want {
+		t.Errorf("destination address = %q, want %q", got, want)
+	}
+}
+
+func TestWriteProxyProtocolHeaderOff(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeProxyProtocolHeader(&buf, ProxyProtocolOff, 3, 7, "127.0.0.1:9001"); err != nil {
+		t.Fatalf("writeProxyProtocolHeader: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no header written when mode is off, got %d bytes", buf.Len())
+	}
+}
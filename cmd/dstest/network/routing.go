@@ -0,0 +1,167 @@
+package network
+
+import (
+	"bytes"
+	"strings"
+)
+
+// RouteMatcher decides, by inspecting the first bytes of a new connection,
+// whether it should be routed to a different receiver than the
+// interceptor's static PortMap entry says. This lets one interceptor port
+// fan a single client connection out to different replicas based on its
+// content, e.g. SNI, HTTP Host, or a binary handshake prefix.
+type RouteMatcher interface {
+	// Match inspects the bytes peeked from the connection so far (which
+	// may still be an incomplete message) and reports the receiver to
+	// route to, and whether it matched.
+	Match(peeked []byte) (receiver int, matched bool)
+	// Name identifies the matcher, recorded in the scheduler event tag
+	// for reproducibility.
+	Name() string
+}
+
+// PrefixMatcher routes a connection to Receiver if its first bytes equal
+// Prefix, for arbitrary binary handshakes.
+type PrefixMatcher struct {
+	Prefix   []byte
+	Receiver int
+}
+
+func (m PrefixMatcher) Match(peeked []byte) (int, bool) {
+	if len(peeked) < len(m.Prefix) {
+		return 0, false
+	}
+	if bytes.Equal(peeked[:len(m.Prefix)], m.Prefix) {
+		return m.Receiver, true
+	}
+	return 0, false
+}
+
+func (m PrefixMatcher) Name() string { return "prefix" }
+
+// HTTPHostMatcher routes a connection to Receiver if its HTTP/1 request
+// carries a Host header equal to Host.
+type HTTPHostMatcher struct {
+	Host     string
+	Receiver int
+}
+
+func (m HTTPHostMatcher) Match(peeked []byte) (int, bool) {
+	headerEnd := bytes.Index(peeked, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(peeked[:headerEnd]), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Host") {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(value), m.Host) {
+			return m.Receiver, true
+		}
+	}
+	return 0, false
+}
+
+func (m HTTPHostMatcher) Name() string { return "http-host" }
+
+// SNIMatcher routes a connection to Receiver if the TLS ClientHello it
+// opens with carries a server_name extension equal to Hostname.
+type SNIMatcher struct {
+	Hostname string
+	Receiver int
+}
+
+func (m SNIMatcher) Match(peeked []byte) (int, bool) {
+	hostname, ok := parseClientHelloSNI(peeked)
+	if !ok {
+		return 0, false
+	}
+	if strings.EqualFold(hostname, m.Hostname) {
+		return m.Receiver, true
+	}
+	return 0, false
+}
+
+func (m SNIMatcher) Name() string { return "sni" }
+
+// parseClientHelloSNI extracts the server_name extension from a raw TLS
+// ClientHello. It returns false if peeked doesn't yet hold enough bytes to
+// find one, so the caller can retry with a larger peek window.
+func parseClientHelloSNI(peeked []byte) (string, bool) {
+	if len(peeked) < 5 || peeked[0] != 0x16 { // TLS handshake record
+		return "", false
+	}
+	recordLen := int(peeked[3])<<8 | int(peeked[4])
+	if len(peeked) < 5+recordLen {
+		return "", false
+	}
+	body := peeked[5 : 5+recordLen]
+
+	if len(body) < 4 || body[0] != 0x01 { // ClientHello handshake type
+		return "", false
+	}
+	hsLen := int(body[1])<<16 | int(body[2])<<8 | int(body[3])
+	if len(body) < 4+hsLen {
+		return "", false
+	}
+	hs := body[4 : 4+hsLen]
+
+	pos := 2 + 32 // client_version + random
+	if len(hs) < pos+1 {
+		return "", false
+	}
+	pos += 1 + int(hs[pos]) // session_id
+
+	if len(hs) < pos+2 {
+		return "", false
+	}
+	pos += 2 + (int(hs[pos])<<8 | int(hs[pos+1])) // cipher_suites
+
+	if len(hs) < pos+1 {
+		return "", false
+	}
+	pos += 1 + int(hs[pos]) // compression_methods
+
+	if len(hs) < pos+2 {
+		return "", false
+	}
+	extensionsLen := int(hs[pos])<<8 | int(hs[pos+1])
+	pos += 2
+	if len(hs) < pos+extensionsLen {
+		return "", false
+	}
+	extensions := hs[pos : pos+extensionsLen]
+
+	for len(extensions) >= 4 {
+		extType := int(extensions[0])<<8 | int(extensions[1])
+		extLen := int(extensions[2])<<8 | int(extensions[3])
+		extensions = extensions[4:]
+		if len(extensions) < extLen {
+			return "", false
+		}
+		extData := extensions[:extLen]
+		extensions = extensions[extLen:]
+
+		if extType != 0x00 { // server_name
+			continue
+		}
+		if len(extData) < 2 {
+			continue
+		}
+		list := extData[2:]
+		for len(list) >= 3 {
+			nameType := list[0]
+			nameLen := int(list[1])<<8 | int(list[2])
+			list = list[3:]
+			if len(list) < nameLen {
+				break
+			}
+			if nameType == 0x00 { // host_name
+				return string(list[:nameLen]), true
+			}
+			list = list[nameLen:]
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+package network
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSNIMatcherMatchesRealClientHello(t *testing.T) {
+	peeked := captureClientHello(t, "example.com")
+
+	m := SNIMatcher{Hostname: "example.com", Receiver: 7}
+	receiver, matched := m.Match(peeked)
+	if !matched {
+		t.Fatal("expected SNIMatcher to match a real ClientHello for the configured hostname")
+	}
+	if receiver != 7 {
+		t.Errorf("receiver = %d, want 7", receiver)
+	}
+
+	miss := SNIMatcher{Hostname: "other.example.com", Receiver: 7}
+	if _, matched := miss.Match(peeked); matched {
+		t.Fatal("expected SNIMatcher not to match a different hostname")
+	}
+}
+
+func TestParseClientHelloSNIOnTruncatedInput(t *testing.T) {
+	peeked := captureClientHello(t, "example.com")
+
+	if _, ok := parseClientHelloSNI(peeked[:len(peeked)/2]); ok {
+		t.Fatal("expected parseClientHelloSNI to report incomplete rather than match on truncated input")
+	}
+}
+
+func TestHTTPHostMatcher(t *testing.T) {
+	request := []byte("GET /shard1 HTTP/1.1\r\nHost: node-a.cluster.local\r\nUser-Agent: test\r\n\r\n")
+
+	m := HTTPHostMatcher{Host: "node-a.cluster.local", Receiver: 3}
+	if receiver, matched := m.Match(request); !matched || receiver != 3 {
+		t.Fatalf("Match = (%d, %v), want (3, true)", receiver, matched)
+	}
+
+	miss := HTTPHostMatcher{Host: "node-b.cluster.local", Receiver: 3}
+	if _, matched := miss.Match(request); matched {
+		t.Fatal("expected no match for a different Host header")
+	}
+
+	if _, matched := m.Match(request[:10]); matched {
+		t.Fatal("expected no match before the headers have fully arrived")
+	}
+}
+
+func TestPrefixMatcher(t *testing.T) {
+	m := PrefixMatcher{Prefix: []byte("RAFTv1"), Receiver: 2}
+
+	if receiver, matched := m.Match([]byte("RAFTv1-appendentries")); !matched || receiver != 2 {
+		t.Fatalf("Match = (%d, %v), want (2, true)", receiver, matched)
+	}
+	if _, matched := m.Match([]byte("RAFT")); matched {
+		t.Fatal("expected no match on a too-short peek")
+	}
+	if _, matched := m.Match([]byte("gRPCv2-unary")); matched {
+		t.Fatal("expected no match on a different prefix")
+	}
+}
+
+// captureClientHello drives a real crypto/tls handshake far enough to
+// capture the exact bytes of the ClientHello it sends for serverName,
+// without needing an actual TLS server on the other end of the
+// connection.
+func captureClientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tls.Client(clientConn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+	}()
+
+	serverConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4096)
+	n, err := serverConn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading ClientHello: %v", err)
+	}
+
+	clientConn.Close()
+	<-done
+
+	return buf[:n]
+}
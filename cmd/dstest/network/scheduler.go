@@ -0,0 +1,40 @@
+package network
+
+// Direction indicates which way a framed message is travelling through an
+// interceptor.
+type Direction int
+
+const (
+	ClientToTarget Direction = iota
+	TargetToClient
+)
+
+func (d Direction) String() string {
+	if d == ClientToTarget {
+		return "client->target"
+	}
+	return "target->client"
+}
+
+// SchedulerEvent is submitted to the scheduler for every framed message an
+// interceptor forwards, so fault injection and ordering control apply to
+// TCP traffic the same way they already do to UDP datagrams.
+type SchedulerEvent struct {
+	Sender    int
+	Receiver  int
+	Direction Direction
+	Seq       uint64
+	Payload   []byte
+
+	// MatcherName records which RouteMatcher (if any) selected Receiver
+	// for this connection, so a run can be reproduced deterministically.
+	MatcherName string
+}
+
+// Scheduler decides when (and whether) a submitted event is allowed to
+// proceed. Schedule blocks until the scheduler releases the event, and
+// returns an error if the event is rejected outright (e.g. the scheduler
+// or the interceptor is shutting down).
+type Scheduler interface {
+	Schedule(event SchedulerEvent) error
+}
@@ -0,0 +1,78 @@
+package network
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// terminationCheckInterval is how often a connTerminator polls for
+// inactivity once it's started.
+const terminationCheckInterval = 50 * time.Millisecond
+
+// connTerminator enforces TerminationDelay for a proxied connection once
+// one direction has half-closed: if the still-open direction goes idle
+// for at least delay, onTimeout is invoked to force-close both sides.
+// touch must be called by the still-open direction every time it makes
+// progress, so a slow-but-alive peer (e.g. a request/response RPC that
+// half-closes after writing its request and takes a while to answer)
+// isn't killed by a fixed countdown from the first half-close.
+type connTerminator struct {
+	delay        time.Duration
+	onTimeout    func()
+	lastActivity int64 // unix nano, accessed atomically
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+func newConnTerminator(delay time.Duration, onTimeout func()) *connTerminator {
+	t := &connTerminator{
+		delay:     delay,
+		onTimeout: onTimeout,
+		done:      make(chan struct{}),
+	}
+	t.touch()
+	return t
+}
+
+// touch records activity now, resetting how long the connection can stay
+// idle before the countdown (once started) times it out.
+func (t *connTerminator) touch() {
+	atomic.StoreInt64(&t.lastActivity, time.Now().UnixNano())
+}
+
+func (t *connTerminator) idleSince() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&t.lastActivity)))
+}
+
+// start begins polling for inactivity in the background. It's idempotent,
+// so either direction half-closing can call it once it's done.
+func (t *connTerminator) start() {
+	t.startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(terminationCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-t.done:
+					return
+				case <-ticker.C:
+					if t.idleSince() >= t.delay {
+						t.onTimeout()
+						return
+					}
+				}
+			}
+		}()
+	})
+}
+
+// stop cancels the countdown. Safe to call multiple times, and whether or
+// not start was ever called.
+func (t *connTerminator) stop() {
+	t.stopOnce.Do(func() {
+		close(t.done)
+	})
+}
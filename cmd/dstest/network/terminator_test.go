@@ -0,0 +1,75 @@
+package network
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnTerminatorFiresAfterInactivity(t *testing.T) {
+	var fired int32
+	term := newConnTerminator(100*time.Millisecond, func() { atomic.StoreInt32(&fired, 1) })
+	term.start()
+	defer term.stop()
+
+	if atomic.LoadInt32(&fired) != 0 {
+		t.Fatal("onTimeout fired before delay elapsed")
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if atomic.LoadInt32(&fired) != 1 {
+		t.Fatal("onTimeout did not fire after the connection went idle")
+	}
+}
+
+// TestConnTerminatorDoesNotFireWhileTouched checks the bug this type
+// exists to fix: a still-open side that keeps making progress past the
+// delay must not be killed, because a fixed countdown from the first
+// half-close can't tell that apart from a genuinely hung peer.
+func TestConnTerminatorDoesNotFireWhileTouched(t *testing.T) {
+	var fired int32
+	delay := 100 * time.Millisecond
+	term := newConnTerminator(delay, func() { atomic.StoreInt32(&fired, 1) })
+	term.start()
+	defer term.stop()
+
+	deadline := time.Now().Add(5 * delay)
+	for time.Now().Before(deadline) {
+		term.touch()
+		time.Sleep(delay / 4)
+	}
+
+	if atomic.LoadInt32(&fired) != 0 {
+		t.Fatal("onTimeout fired even though the connection kept making progress")
+	}
+}
+
+func TestConnTerminatorStopPreventsLateFire(t *testing.T) {
+	var fired int32
+	term := newConnTerminator(30*time.Millisecond, func() { atomic.StoreInt32(&fired, 1) })
+	term.start()
+	term.stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if atomic.LoadInt32(&fired) != 0 {
+		t.Fatal("onTimeout fired after stop was called")
+	}
+}
+
+func TestConnTerminatorStartIsIdempotent(t *testing.T) {
+	var calls int32
+	term := newConnTerminator(20*time.Millisecond, func() { atomic.AddInt32(&calls, 1) })
+
+	term.start()
+	term.start()
+	term.start()
+	defer term.stop()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("onTimeout called %d times, want exactly 1", got)
+	}
+}